@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/cyverse-de/job-status-listener/httperr"
+)
+
+// Defaults for the bulk.max_items and bulk.workers config knobs, used when
+// they aren't set (or are non-positive) in the loaded configuration.
+const (
+	defaultBulkMaxItems = 500
+	defaultBulkWorkers  = 8
+)
+
+// bulkRequest is the envelope accepted by POST /status/bulk.
+type bulkRequest struct {
+	Updates []MessagePostWithUUIDs `json:"updates"`
+}
+
+// bulkResult is one entry of the response array returned by POST
+// /status/bulk, in the same order as the corresponding entry in the
+// request's Updates.
+type bulkResult struct {
+	JobUUID string                  `json:"job_uuid"`
+	Status  string                  `json:"status"`
+	Problem *httperr.ProblemDetails `json:"problem,omitempty"`
+}
+
+func bulkMaxItems() int {
+	if cfg != nil {
+		if v := cfg.GetInt("bulk.max_items"); v > 0 {
+			return v
+		}
+	}
+	return defaultBulkMaxItems
+}
+
+func bulkWorkers() int {
+	if cfg != nil {
+		if v := cfg.GetInt("bulk.workers"); v > 0 {
+			return v
+		}
+	}
+	return defaultBulkWorkers
+}
+
+// postBulkStatus decodes a batch of job status updates and publishes them
+// concurrently through a bounded worker pool, returning a per-item result
+// array in input order. Per-item publish failures are handed off to the
+// durable outbox (see update) rather than aborting the request.
+func postBulkStatus(publisher JobUpdatePublisher, w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var body bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Error(err)
+		httperr.WriteProblemFromErr(w, r, &httperr.InvalidJSONError{Err: err})
+		return
+	}
+
+	maxItems := bulkMaxItems()
+	if len(body.Updates) > maxItems {
+		err := fmt.Errorf("request contains %d updates, which exceeds the bulk.max_items limit of %d", len(body.Updates), maxItems)
+		log.Error(err)
+		httperr.WriteProblem(w, r, http.StatusBadRequest, httperr.TypeTooManyItems, "Too many updates", err.Error())
+		return
+	}
+
+	results := make([]bulkResult, len(body.Updates))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := bulkWorkers()
+	if workers > len(body.Updates) {
+		workers = len(body.Updates)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				results[idx] = bulkPublish(ctx, publisher, r.URL.Path, body.Updates[idx])
+			}
+		}()
+	}
+
+	for idx := range body.Updates {
+		indices <- idx
+	}
+	close(indices)
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, res := range results {
+		if res.Status == "error" {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// bulkPublish validates and publishes a single bulk item, returning its
+// per-item result. An update that was durably spooled counts as "ok" since
+// it's been safely recorded, just not delivered yet.
+func bulkPublish(ctx context.Context, publisher JobUpdatePublisher, instance string, item MessagePostWithUUIDs) bulkResult {
+	state, err := getState(item.State)
+	if err != nil {
+		problem := httperr.ProblemFromErr(instance, err)
+		return bulkResult{JobUUID: item.JobUUID, Status: "error", Problem: &problem}
+	}
+
+	_, err = update(ctx, publisher, state, item.JobUUID, item.Hostname, item.Message)
+	if err != nil {
+		var spooled *SpooledError
+		if errors.As(err, &spooled) {
+			return bulkResult{JobUUID: item.JobUUID, Status: "ok"}
+		}
+		problem := httperr.ProblemFromErr(instance, err)
+		return bulkResult{JobUUID: item.JobUUID, Status: "error", Problem: &problem}
+	}
+
+	return bulkResult{JobUUID: item.JobUUID, Status: "ok"}
+}
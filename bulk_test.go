@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyverse-de/messaging/v9"
+	"github.com/spf13/viper"
+)
+
+// selectivePublisher is a JobUpdatePublisher that fails for a configurable
+// set of job UUIDs and tracks how many publishes are in flight at once, so
+// tests can assert on partial-failure semantics and worker-pool
+// back-pressure.
+type selectivePublisher struct {
+	failFor map[string]bool
+
+	mu        sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (p *selectivePublisher) PublishJobUpdate(ctx context.Context, msg *messaging.UpdateMessage) error {
+	p.mu.Lock()
+	p.active++
+	if p.active > p.maxActive {
+		p.maxActive = p.active
+	}
+	p.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+
+	if p.failFor[msg.Job.InvocationID] {
+		return errors.New("boom")
+	}
+	return nil
+}
+func (p *selectivePublisher) Reconnect() error { return nil }
+func (p *selectivePublisher) Close()           {}
+func (p *selectivePublisher) SpoolUpdate(msg *messaging.UpdateMessage) (string, error) {
+	return "", errors.New("no spool configured for this publisher")
+}
+func (p *selectivePublisher) Notify(msg *messaging.UpdateMessage) {}
+func (p *selectivePublisher) Subscribe() chan *messaging.UpdateMessage {
+	return make(chan *messaging.UpdateMessage)
+}
+func (p *selectivePublisher) Unsubscribe(ch chan *messaging.UpdateMessage) {}
+func (p *selectivePublisher) Healthy() error                               { return nil }
+
+func bulkRequestBody(t *testing.T, jobIDs []string) []byte {
+	t.Helper()
+
+	updates := make([]MessagePostWithUUIDs, len(jobIDs))
+	for i, id := range jobIDs {
+		updates[i] = MessagePostWithUUIDs{JobUUID: id, Hostname: "h", Message: "m", State: "running"}
+	}
+
+	body, err := json.Marshal(bulkRequest{Updates: updates})
+	if err != nil {
+		t.Fatalf("failed to marshal bulk request: %s", err)
+	}
+	return body
+}
+
+// TestPostBulkStatusOrderingAndPartialFailure asserts the response
+// preserves input order and reports a 207 with a mix of "ok"/"error"
+// results when only some items fail to publish.
+func TestPostBulkStatusOrderingAndPartialFailure(t *testing.T) {
+	jobIDs := []string{"job-1", "job-2", "job-3", "job-4"}
+	publisher := &selectivePublisher{failFor: map[string]bool{"job-2": true, "job-4": true}}
+
+	req := httptest.NewRequest(http.MethodPost, "/status/bulk", bytes.NewReader(bulkRequestBody(t, jobIDs)))
+	rec := httptest.NewRecorder()
+
+	postBulkStatus(publisher, rec, req)
+
+	if rec.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusMultiStatus)
+	}
+
+	var results []bulkResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("failed to decode results: %s", err)
+	}
+
+	if len(results) != len(jobIDs) {
+		t.Fatalf("got %d results, want %d", len(results), len(jobIDs))
+	}
+
+	wantStatus := map[string]string{"job-1": "ok", "job-2": "error", "job-3": "ok", "job-4": "error"}
+	for i, id := range jobIDs {
+		if results[i].JobUUID != id {
+			t.Fatalf("result %d job_uuid = %q, want %q (ordering not preserved)", i, results[i].JobUUID, id)
+		}
+		if results[i].Status != wantStatus[id] {
+			t.Fatalf("job %s status = %q, want %q", id, results[i].Status, wantStatus[id])
+		}
+		if results[i].Status == "error" && results[i].Problem == nil {
+			t.Fatalf("job %s reported an error with no problem details", id)
+		}
+	}
+}
+
+// TestPostBulkStatusBackPressure asserts concurrency is bounded by
+// bulk.workers rather than firing every publish at once.
+func TestPostBulkStatusBackPressure(t *testing.T) {
+	prevCfg := cfg
+	defer func() { cfg = prevCfg }()
+
+	cfg = viper.New()
+	cfg.Set("bulk.workers", 2)
+
+	jobIDs := make([]string, 10)
+	for i := range jobIDs {
+		jobIDs[i] = fmt.Sprintf("job-%d", i)
+	}
+	publisher := &selectivePublisher{}
+
+	req := httptest.NewRequest(http.MethodPost, "/status/bulk", bytes.NewReader(bulkRequestBody(t, jobIDs)))
+	rec := httptest.NewRecorder()
+
+	postBulkStatus(publisher, rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	publisher.mu.Lock()
+	maxActive := publisher.maxActive
+	publisher.mu.Unlock()
+
+	if maxActive > 2 {
+		t.Fatalf("max concurrent publishes = %d, want <= 2 (bulk.workers not respected)", maxActive)
+	}
+}
+
+// TestPostBulkStatusMaxItems asserts the envelope is rejected outright once
+// it exceeds bulk.max_items, without publishing anything.
+func TestPostBulkStatusMaxItems(t *testing.T) {
+	prevCfg := cfg
+	defer func() { cfg = prevCfg }()
+
+	cfg = viper.New()
+	cfg.Set("bulk.max_items", 2)
+
+	jobIDs := []string{"job-1", "job-2", "job-3"}
+	publisher := &selectivePublisher{}
+
+	req := httptest.NewRequest(http.MethodPost, "/status/bulk", bytes.NewReader(bulkRequestBody(t, jobIDs)))
+	rec := httptest.NewRecorder()
+
+	postBulkStatus(publisher, rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	publisher.mu.Lock()
+	maxActive := publisher.maxActive
+	publisher.mu.Unlock()
+	if maxActive != 0 {
+		t.Fatalf("publisher was invoked despite the envelope exceeding bulk.max_items")
+	}
+}
@@ -0,0 +1,79 @@
+// Package bus implements a small in-process publish/subscribe fan-out for
+// job status updates, modeled on the event bus split out of the
+// Woodpecker/Drone CI servers. It lets HTTP handlers (e.g. the SSE
+// endpoint) observe the same updates published to AMQP without needing
+// broker credentials.
+package bus
+
+import (
+	"sync"
+
+	"github.com/cyverse-de/messaging/v9"
+)
+
+// subscriberBuffer is the number of updates buffered per subscriber before
+// the oldest queued update is dropped to make room for the newest one.
+const subscriberBuffer = 64
+
+// Bus fans out published updates to any number of subscribers. It is safe
+// for concurrent use.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan *messaging.UpdateMessage]struct{}
+}
+
+// New returns an empty Bus.
+func New() *Bus {
+	return &Bus{
+		subs: make(map[chan *messaging.UpdateMessage]struct{}),
+	}
+}
+
+// Publish fans msg out to every current subscriber. A subscriber whose
+// buffer is full has its oldest queued update dropped to make room for
+// msg, so a slow consumer can't block the publisher.
+func (b *Bus) Publish(msg *messaging.UpdateMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- msg:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe registers and returns a new buffered channel that receives
+// every update published from this point forward. Callers must pass the
+// returned channel to Unsubscribe once they're done with it.
+func (b *Bus) Subscribe() chan *messaging.UpdateMessage {
+	ch := make(chan *messaging.UpdateMessage, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe removes ch from the bus and closes it. It is a no-op if ch
+// isn't currently subscribed.
+func (b *Bus) Unsubscribe(ch chan *messaging.UpdateMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[ch]; !ok {
+		return
+	}
+	delete(b.subs, ch)
+	close(ch)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cyverse-de/job-status-listener/httperr"
+	"github.com/cyverse-de/messaging/v9"
+	"github.com/gorilla/mux"
+)
+
+// fakePublisher is a JobUpdatePublisher whose every outcome is controlled
+// by its fields, so handler tests can drive each failure mode without a
+// live AMQP broker.
+type fakePublisher struct {
+	publishErr   error
+	reconnectErr error
+	spoolToken   string
+	spoolErr     error
+}
+
+func (f *fakePublisher) PublishJobUpdate(ctx context.Context, msg *messaging.UpdateMessage) error {
+	return f.publishErr
+}
+func (f *fakePublisher) Reconnect() error { return f.reconnectErr }
+func (f *fakePublisher) Close()           {}
+func (f *fakePublisher) SpoolUpdate(msg *messaging.UpdateMessage) (string, error) {
+	return f.spoolToken, f.spoolErr
+}
+func (f *fakePublisher) Notify(msg *messaging.UpdateMessage) {}
+func (f *fakePublisher) Subscribe() chan *messaging.UpdateMessage {
+	return make(chan *messaging.UpdateMessage)
+}
+func (f *fakePublisher) Unsubscribe(ch chan *messaging.UpdateMessage) {}
+func (f *fakePublisher) Healthy() error                               { return nil }
+
+// TestPostUpdateProblemResponses exercises every problem+json failure mode
+// postUpdate can produce.
+func TestPostUpdateProblemResponses(t *testing.T) {
+	const uuid = "11111111-1111-1111-1111-111111111111"
+
+	tests := []struct {
+		name       string
+		body       string
+		publisher  *fakePublisher
+		wantStatus int
+		wantType   string
+	}{
+		{
+			name:       "invalid json",
+			body:       `{`,
+			publisher:  &fakePublisher{},
+			wantStatus: http.StatusBadRequest,
+			wantType:   httperr.TypeInvalidJSON,
+		},
+		{
+			name:       "unknown state",
+			body:       `{"Hostname":"h","Message":"m","State":"bogus"}`,
+			publisher:  &fakePublisher{},
+			wantStatus: http.StatusBadRequest,
+			wantType:   httperr.TypeUnknownState,
+		},
+		{
+			name: "amqp unavailable",
+			body: `{"Hostname":"h","Message":"m","State":"running"}`,
+			publisher: &fakePublisher{
+				publishErr:   errors.New("publish failed"),
+				reconnectErr: errors.New("connection refused"),
+				spoolErr:     errors.New("no spool configured"),
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantType:   httperr.TypeAMQPUnavailable,
+		},
+		{
+			name: "publish failed",
+			body: `{"Hostname":"h","Message":"m","State":"running"}`,
+			publisher: &fakePublisher{
+				publishErr: errors.New("publish failed"),
+				spoolErr:   errors.New("no spool configured"),
+			},
+			wantStatus: http.StatusBadGateway,
+			wantType:   httperr.TypePublishFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/"+uuid+"/status", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"uuid": uuid})
+			rec := httptest.NewRecorder()
+
+			postUpdate(tt.publisher, rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+			}
+
+			var problem httperr.ProblemDetails
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("failed to decode problem body: %s", err)
+			}
+			if problem.Type != tt.wantType {
+				t.Fatalf("problem type = %q, want %q", problem.Type, tt.wantType)
+			}
+			if problem.Status != tt.wantStatus {
+				t.Fatalf("problem status = %d, want %d", problem.Status, tt.wantStatus)
+			}
+			if problem.Instance != req.URL.Path {
+				t.Fatalf("problem instance = %q, want %q", problem.Instance, req.URL.Path)
+			}
+		})
+	}
+}
+
+// TestPostUpdateSpooled confirms a durably-spooled update is reported as
+// 202 Accepted with its token, not as a problem+json error.
+func TestPostUpdateSpooled(t *testing.T) {
+	const uuid = "22222222-2222-2222-2222-222222222222"
+
+	publisher := &fakePublisher{
+		publishErr: errors.New("publish failed"),
+		spoolToken: "some-token",
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/"+uuid+"/status", bytes.NewBufferString(`{"Hostname":"h","Message":"m","State":"running"}`))
+	req = mux.SetURLVars(req, map[string]string{"uuid": uuid})
+	rec := httptest.NewRecorder()
+
+	postUpdate(publisher, rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode body: %s", err)
+	}
+	if body["token"] != "some-token" {
+		t.Fatalf("token = %q, want %q", body["token"], "some-token")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/job-status-listener/httperr"
+	"github.com/sirupsen/logrus"
+)
+
+// buildVersion is overridden at build time via -ldflags, as with other
+// cyverse-de services. It's reported by /health_check for operators to
+// confirm which build is deployed.
+var buildVersion = "dev"
+
+var startTime = time.Now()
+
+// readinessProbeInterval is how often the background prober calls the
+// publisher's Healthy method. Healthy reports the outcome of the most
+// recent publish or reconnect attempt; the AMQP connection itself is not
+// pinged.
+const readinessProbeInterval = 15 * time.Second
+
+func healthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"service": serviceName,
+		"version": buildVersion,
+		"uptime":  time.Since(startTime).String(),
+	})
+}
+
+// readinessProber periodically calls JobUpdatePublisher.Healthy() in the
+// background and caches the result, so the /ready handler never performs
+// synchronous AMQP I/O on the request path.
+type readinessProber struct {
+	mu      sync.RWMutex
+	lastErr error
+}
+
+// newReadinessProber starts a background goroutine that probes publisher's
+// health every interval, and returns immediately with the result of an
+// initial synchronous probe.
+func newReadinessProber(publisher JobUpdatePublisher, interval time.Duration) *readinessProber {
+	p := &readinessProber{}
+	p.probe(publisher)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			p.probe(publisher)
+		}
+	}()
+
+	return p
+}
+
+func (p *readinessProber) probe(publisher JobUpdatePublisher) {
+	err := publisher.Healthy()
+	if err != nil {
+		log.Errorf("readiness probe failed: %s", err)
+	}
+
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+}
+
+// Err returns the error from the most recent probe, or nil if the
+// connection was healthy.
+func (p *readinessProber) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastErr
+}
+
+func readyCheck(prober *readinessProber) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := prober.Err(); err != nil {
+			httperr.WriteProblemFromErr(w, r, &httperr.AMQPUnavailableError{Err: err})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+	}
+}
+
+// logLevelRequest is the body accepted by PUT /admin/log.
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// adminLogLevel reconfigures the logrus level at runtime, so operators can
+// bump verbosity without a redeploy.
+func adminLogLevel(w http.ResponseWriter, r *http.Request) {
+	var body logLevelRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		log.Error(err)
+		httperr.WriteProblemFromErr(w, r, &httperr.InvalidJSONError{Err: err})
+		return
+	}
+
+	level, err := logrus.ParseLevel(body.Level)
+	if err != nil {
+		log.Error(err)
+		httperr.WriteProblem(w, r, http.StatusBadRequest, httperr.TypeInvalidLogLevel, "Invalid log level", err.Error())
+		return
+	}
+
+	logrus.SetLevel(level)
+	log.Infof("log level changed to %s", level)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(map[string]string{"level": level.String()})
+}
@@ -0,0 +1,112 @@
+// Package httperr implements RFC 7807 (application/problem+json) error
+// responses for the HTTP handlers in main.go, along with the small
+// taxonomy of structured error types this service needs in order to pick
+// the right problem type and status code for a given failure.
+package httperr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Stable Type URIs for the problem classes this service produces.
+const (
+	TypeInvalidJSON     = "/problems/invalid-json"
+	TypeUnknownState    = "/problems/unknown-state"
+	TypePublishFailed   = "/problems/publish-failed"
+	TypeAMQPUnavailable = "/problems/amqp-unavailable"
+	TypeTooManyItems    = "/problems/too-many-items"
+	TypeInvalidLogLevel = "/problems/invalid-log-level"
+)
+
+// ProblemDetails is the RFC 7807 problem+json response body.
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// InvalidJSONError indicates a request body could not be decoded.
+type InvalidJSONError struct {
+	Err error
+}
+
+func (e *InvalidJSONError) Error() string { return fmt.Sprintf("invalid request body: %s", e.Err) }
+func (e *InvalidJSONError) Unwrap() error { return e.Err }
+
+// UnknownStateError indicates the requested job state isn't one this
+// service recognizes.
+type UnknownStateError struct {
+	State string
+}
+
+func (e *UnknownStateError) Error() string { return fmt.Sprintf("unknown job state: %s", e.State) }
+
+// AMQPUnavailableError indicates the AMQP broker could not be reached at
+// all, even after a reconnect attempt.
+type AMQPUnavailableError struct {
+	Err error
+}
+
+func (e *AMQPUnavailableError) Error() string { return fmt.Sprintf("amqp unavailable: %s", e.Err) }
+func (e *AMQPUnavailableError) Unwrap() error { return e.Err }
+
+// PublishFailedError indicates a live AMQP connection rejected the
+// publish.
+type PublishFailedError struct {
+	Err error
+}
+
+func (e *PublishFailedError) Error() string { return fmt.Sprintf("publish failed: %s", e.Err) }
+func (e *PublishFailedError) Unwrap() error { return e.Err }
+
+// WriteProblem writes a problem+json response built from the given
+// fields, using r's URL path as the Instance.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, problemType, title, detail string) {
+	p := ProblemDetails{
+		Type:     problemType,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// ProblemFromErr maps err to the ProblemDetails for this service's known
+// failure classes, using instance as the Instance field. Errors outside
+// that taxonomy map to a generic 500. Callers that aren't writing directly
+// to an http.ResponseWriter (e.g. per-item results in a bulk response) can
+// use this instead of WriteProblemFromErr.
+func ProblemFromErr(instance string, err error) ProblemDetails {
+	switch e := err.(type) {
+	case *InvalidJSONError:
+		return ProblemDetails{Type: TypeInvalidJSON, Title: "Invalid request body", Status: http.StatusBadRequest, Detail: e.Error(), Instance: instance}
+	case *UnknownStateError:
+		return ProblemDetails{Type: TypeUnknownState, Title: "Unknown job state", Status: http.StatusBadRequest, Detail: e.State, Instance: instance}
+	case *AMQPUnavailableError:
+		return ProblemDetails{Type: TypeAMQPUnavailable, Title: "AMQP broker unavailable", Status: http.StatusServiceUnavailable, Detail: e.Error(), Instance: instance}
+	case *PublishFailedError:
+		return ProblemDetails{Type: TypePublishFailed, Title: "Failed to publish job status update", Status: http.StatusBadGateway, Detail: e.Error(), Instance: instance}
+	default:
+		return ProblemDetails{Type: "about:blank", Title: "Internal server error", Status: http.StatusInternalServerError, Detail: err.Error(), Instance: instance}
+	}
+}
+
+// WriteProblemFromErr maps err to the appropriate problem type, title, and
+// status code for this service's known failure classes and writes it as a
+// problem+json response. Errors outside that taxonomy are reported as a
+// generic 500.
+func WriteProblemFromErr(w http.ResponseWriter, r *http.Request, err error) {
+	p := ProblemFromErr(r.URL.Path, err)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	_ "expvar"
 	"flag"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/cyverse-de/configurate"
 	"github.com/cyverse-de/go-mod/otelutils"
+	"github.com/cyverse-de/job-status-listener/httperr"
 	"github.com/cyverse-de/model/v6"
 	"github.com/spf13/viper"
 
@@ -35,6 +37,17 @@ var (
 	cfg     *viper.Viper
 )
 
+// SpooledError indicates that a job status update could not be published
+// directly, but was durably queued in the on-disk outbox under Token for a
+// background drainer to deliver once the AMQP connection recovers.
+type SpooledError struct {
+	Token string
+}
+
+func (e *SpooledError) Error() string {
+	return fmt.Sprintf("update spooled for later delivery as %s", e.Token)
+}
+
 func update(ctx context.Context, publisher JobUpdatePublisher, state messaging.JobState, jobID string, hostname string, msg string) (*messaging.UpdateMessage, error) {
 	updateMessage := &messaging.UpdateMessage{
 		Job:     &model.Job{InvocationID: jobID},
@@ -46,6 +59,7 @@ func update(ctx context.Context, publisher JobUpdatePublisher, state messaging.J
 	err := publisher.PublishJobUpdate(ctx, updateMessage)
 	if err == nil {
 		log.Infof("%s (%s) [%s]: %s", jobID, state, hostname, msg)
+		publisher.Notify(updateMessage)
 		return updateMessage, nil
 	}
 
@@ -57,18 +71,36 @@ func update(ctx context.Context, publisher JobUpdatePublisher, state messaging.J
 	err = publisher.Reconnect()
 	if err != nil {
 		log.Errorf("unable to reestablish the messaging connection: %s", err)
-		return nil, err
+		return spoolOrFail(publisher, updateMessage, jobID, state, hostname, msg, &httperr.AMQPUnavailableError{Err: err})
 	}
 
 	// Attempt to record the message one more time.
 	err = publisher.PublishJobUpdate(ctx, updateMessage)
 	if err == nil {
 		log.Infof("%s (%s) [%s]: %s", jobID, state, hostname, msg)
+		publisher.Notify(updateMessage)
 		return updateMessage, nil
 	}
 
-	log.Errorf("failed to publish job status update again - giving up: %s", err)
-	return nil, err
+	log.Errorf("failed to publish job status update again: %s", err)
+	return spoolOrFail(publisher, updateMessage, jobID, state, hostname, msg, &httperr.PublishFailedError{Err: err})
+}
+
+// spoolOrFail is called once every direct publish attempt has been
+// exhausted. It durably queues updateMessage in the outbox so the update
+// isn't lost to a transient AMQP outage, returning a *SpooledError on
+// success. If the publisher has no spool configured, or enqueuing itself
+// fails, the original publish error is returned instead.
+func spoolOrFail(publisher JobUpdatePublisher, updateMessage *messaging.UpdateMessage, jobID string, state messaging.JobState, hostname, msg string, publishErr error) (*messaging.UpdateMessage, error) {
+	token, spoolErr := publisher.SpoolUpdate(updateMessage)
+	if spoolErr != nil {
+		log.Errorf("failed to spool job status update: %s", spoolErr)
+		return nil, publishErr
+	}
+
+	log.Warnf("spooled %s (%s) [%s]: %s as %s", jobID, state, hostname, msg, token)
+	publisher.Notify(updateMessage)
+	return updateMessage, &SpooledError{Token: token}
 }
 
 // MessagePost describes the structure of the job status update request body.
@@ -101,24 +133,19 @@ func getState(state string) (messaging.JobState, error) {
 	case "failed":
 		return messaging.FailedState, nil
 	default:
-		return "", fmt.Errorf("Unknown job state: %s", state)
+		return "", &httperr.UnknownStateError{State: state}
 	}
 }
 
 func postBatchStatus(publisher JobUpdatePublisher, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	out := json.NewEncoder(w)
 
 	var updateMessage MessagePostWithUUIDs
 
 	err := json.NewDecoder(r.Body).Decode(&updateMessage)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
+		httperr.WriteProblemFromErr(w, r, &httperr.InvalidJSONError{Err: err})
 		return
 	}
 
@@ -126,11 +153,8 @@ func postBatchStatus(publisher JobUpdatePublisher, w http.ResponseWriter, r *htt
 
 	state, err := getState(updateMessage.State)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
+		httperr.WriteProblemFromErr(w, r, err)
 		return
 	}
 
@@ -143,20 +167,26 @@ func postBatchStatus(publisher JobUpdatePublisher, w http.ResponseWriter, r *htt
 
 	msg, err := update(ctx, publisher, state, jobID, updateMessage.Hostname, updateMessage.Message)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		var spooled *SpooledError
+		if errors.As(err, &spooled) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"token": spooled.Token,
+			})
+			return
+		}
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
-		log.Fatal("failed to record a valid job status update - aborting")
+		httperr.WriteProblemFromErr(w, r, err)
+		return
 	}
-	_ = out.Encode(msg)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(msg)
 }
 
 func postUpdate(publisher JobUpdatePublisher, w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	out := json.NewEncoder(w)
 
 	var updateMessage MessagePost
 
@@ -165,38 +195,39 @@ func postUpdate(publisher JobUpdatePublisher, w http.ResponseWriter, r *http.Req
 
 	err := json.NewDecoder(r.Body).Decode(&updateMessage)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
+		httperr.WriteProblemFromErr(w, r, &httperr.InvalidJSONError{Err: err})
 		return
 	}
 
 	state, err := getState(updateMessage.State)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
+		httperr.WriteProblemFromErr(w, r, err)
 		return
 	}
 
 	msg, err := update(ctx, publisher, state, jobID, updateMessage.Hostname, updateMessage.Message)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		var spooled *SpooledError
+		if errors.As(err, &spooled) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"token": spooled.Token,
+			})
+			return
+		}
 		log.Error(err)
-		_ = out.Encode(map[string]string{
-			"error": err.Error(),
-		})
-		log.Fatal("failed to record a valid job status update - aborting")
+		httperr.WriteProblemFromErr(w, r, err)
+		return
 	}
-	_ = out.Encode(msg)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(msg)
 }
 
 func init() {
-	flag.Parse()
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 }
 
@@ -222,11 +253,31 @@ func newRouter(publisher JobUpdatePublisher) *mux.Router {
 			postBatchStatus(publisher, w, r)
 		},
 	)
+	r.Path("/status/bulk").Methods("POST").HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			postBulkStatus(publisher, w, r)
+		},
+	)
+	r.Path("/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/events").Methods("GET").HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			sseEvents(publisher, w, r)
+		},
+	)
+	r.Path("/events").Methods("GET").HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			sseEvents(publisher, w, r)
+		},
+	)
+	r.Path("/health_check").Methods("GET").HandlerFunc(healthCheck)
+	r.Path("/ready").Methods("GET").HandlerFunc(readyCheck(newReadinessProber(publisher, readinessProbeInterval)))
+	r.Path("/admin/log").Methods("PUT").HandlerFunc(adminLogLevel)
 
 	return r
 }
 
 func main() {
+	flag.Parse()
+
 	log.Info("Starting up the job-status-listener service.")
 
 	var tracerCtx, cancel = context.WithCancel(context.Background())
@@ -238,8 +289,9 @@ func main() {
 
 	uri := cfg.GetString("amqp.uri")
 	exchange := cfg.GetString("amqp.exchange.name")
+	spoolDir := cfg.GetString("spool.dir")
 
-	publisher, err := NewDefaultJobUpdatePublisher(uri, exchange)
+	publisher, err := NewDefaultJobUpdatePublisher(uri, exchange, spoolDir)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/job-status-listener/bus"
+	"github.com/cyverse-de/job-status-listener/spool"
+	"github.com/cyverse-de/messaging/v9"
+)
+
+// drainInitialBackoff and drainMaxBackoff bound the delay between re-publish
+// attempts in drain, so a sustained AMQP outage doesn't turn into a tight,
+// CPU-pinned retry loop against a connection that isn't coming back.
+const (
+	drainInitialBackoff = time.Second
+	drainMaxBackoff     = 30 * time.Second
+)
+
+// JobUpdatePublisher is the interface implemented by types that can publish
+// job status updates to the rest of the DE. It exists so that the HTTP
+// handlers in main.go can be tested without a live AMQP broker.
+type JobUpdatePublisher interface {
+	PublishJobUpdate(ctx context.Context, msg *messaging.UpdateMessage) error
+	Reconnect() error
+	Close()
+
+	// SpoolUpdate durably queues msg in the on-disk outbox for later
+	// delivery, returning the token it was stored under. It returns an
+	// error if the publisher wasn't configured with a spool.
+	SpoolUpdate(msg *messaging.UpdateMessage) (string, error)
+
+	// Notify fans msg out to every subscriber registered via Subscribe,
+	// independent of (and in addition to) the AMQP publish.
+	Notify(msg *messaging.UpdateMessage)
+
+	// Subscribe registers and returns a new channel that receives every
+	// update Notify is called with from this point forward.
+	Subscribe() chan *messaging.UpdateMessage
+
+	// Unsubscribe removes ch, previously returned by Subscribe, from the
+	// notification fan-out.
+	Unsubscribe(ch chan *messaging.UpdateMessage)
+
+	// Healthy reports whether the AMQP connection is currently usable,
+	// based on the outcome of the most recent publish or reconnect
+	// attempt. A nil return means the connection is up.
+	Healthy() error
+}
+
+// AMQPJobUpdatePublisher is the default JobUpdatePublisher implementation. It
+// publishes job status updates to the configured AMQP exchange, and falls
+// back to an on-disk spool whenever the broker can't be reached so that a
+// transient outage doesn't drop in-flight updates.
+type AMQPJobUpdatePublisher struct {
+	clientMu sync.RWMutex
+	client   *messaging.Client
+
+	uri      string
+	exchange string
+	spool    *spool.Spool
+	bus      *bus.Bus
+
+	healthMu  sync.RWMutex
+	healthErr error
+}
+
+// NewDefaultJobUpdatePublisher connects to the AMQP broker at uri and
+// configures publishing to exchange. If spoolDir is non-empty, a Spool is
+// opened at that path and a drainer goroutine is started to re-publish
+// spooled updates once the connection recovers.
+func NewDefaultJobUpdatePublisher(uri, exchange string, spoolDir string) (*AMQPJobUpdatePublisher, error) {
+	client, err := messaging.NewClient(uri, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the AMQP broker: %w", err)
+	}
+
+	client.SetupPublishing(exchange)
+
+	p := &AMQPJobUpdatePublisher{
+		client:   client,
+		uri:      uri,
+		exchange: exchange,
+		bus:      bus.New(),
+	}
+
+	if spoolDir != "" {
+		s, err := spool.New(spoolDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the spool at %s: %w", spoolDir, err)
+		}
+		p.spool = s
+		go p.drain()
+	}
+
+	return p, nil
+}
+
+// PublishJobUpdate publishes msg to the configured exchange. Callers that
+// need spool-on-failure semantics should go through update (main.go)
+// instead; this method is
+// a thin wrapper kept around so AMQPJobUpdatePublisher continues to satisfy
+// simpler callers and tests.
+func (p *AMQPJobUpdatePublisher) PublishJobUpdate(ctx context.Context, msg *messaging.UpdateMessage) error {
+	p.clientMu.RLock()
+	client := p.client
+	p.clientMu.RUnlock()
+
+	err := client.PublishJobUpdate(msg)
+	p.setHealth(err)
+
+	return err
+}
+
+// Reconnect tears down and re-establishes the AMQP connection and publishing
+// channel.
+func (p *AMQPJobUpdatePublisher) Reconnect() error {
+	client, err := messaging.NewClient(p.uri, true)
+	if err != nil {
+		p.setHealth(err)
+		return err
+	}
+	client.SetupPublishing(p.exchange)
+
+	p.clientMu.Lock()
+	old := p.client
+	p.client = client
+	p.clientMu.Unlock()
+
+	old.Close()
+	p.setHealth(nil)
+
+	return nil
+}
+
+// setHealth records the outcome of the most recent publish or reconnect
+// attempt, for Healthy to report. The messaging client doesn't expose a
+// way to directly probe the underlying connection, so this is the
+// liveness signal available to us.
+func (p *AMQPJobUpdatePublisher) setHealth(err error) {
+	p.healthMu.Lock()
+	p.healthErr = err
+	p.healthMu.Unlock()
+}
+
+// Healthy reports the outcome of the most recent publish or reconnect
+// attempt. A nil return means the connection is up.
+func (p *AMQPJobUpdatePublisher) Healthy() error {
+	p.healthMu.RLock()
+	defer p.healthMu.RUnlock()
+	return p.healthErr
+}
+
+// Close shuts down the AMQP connection and, if present, the spool.
+func (p *AMQPJobUpdatePublisher) Close() {
+	p.clientMu.RLock()
+	client := p.client
+	p.clientMu.RUnlock()
+
+	client.Close()
+	if p.spool != nil {
+		p.spool.Close()
+	}
+}
+
+// SpoolUpdate durably queues msg in the outbox and returns the token it was
+// stored under. It returns an error if no spool was configured for this
+// publisher.
+func (p *AMQPJobUpdatePublisher) SpoolUpdate(msg *messaging.UpdateMessage) (string, error) {
+	if p.spool == nil {
+		return "", errors.New("no spool configured for this publisher")
+	}
+	return p.spool.Enqueue(msg)
+}
+
+// Notify fans msg out to every subscriber registered via Subscribe.
+func (p *AMQPJobUpdatePublisher) Notify(msg *messaging.UpdateMessage) {
+	p.bus.Publish(msg)
+}
+
+// Subscribe registers and returns a new channel that receives every update
+// Notify is called with from this point forward. Pass the returned channel
+// to Unsubscribe once the caller is done with it.
+func (p *AMQPJobUpdatePublisher) Subscribe() chan *messaging.UpdateMessage {
+	return p.bus.Subscribe()
+}
+
+// Unsubscribe removes ch, previously returned by Subscribe, from the
+// notification fan-out.
+func (p *AMQPJobUpdatePublisher) Unsubscribe(ch chan *messaging.UpdateMessage) {
+	p.bus.Unsubscribe(ch)
+}
+
+// drain runs for the lifetime of the publisher, re-publishing spooled
+// updates in FIFO order as the spool reports them ready. An update that
+// fails to publish is retried until it succeeds before the next one is
+// taken. On a publish failure it attempts its own reconnect rather than
+// waiting for an unrelated live request to repair the connection, and backs
+// off between attempts so a sustained outage doesn't spin the CPU hammering
+// a dead connection.
+func (p *AMQPJobUpdatePublisher) drain() {
+	backoff := drainInitialBackoff
+
+	for msg := range p.spool.Ready() {
+		for {
+			err := p.PublishJobUpdate(context.Background(), msg.Update)
+			if err == nil {
+				break
+			}
+			log.Errorf("drain: failed to re-publish spooled update %s: %s", msg.Token, err)
+
+			if rErr := p.Reconnect(); rErr != nil {
+				log.Errorf("drain: failed to reconnect to AMQP: %s", rErr)
+			}
+
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > drainMaxBackoff {
+				backoff = drainMaxBackoff
+			}
+		}
+
+		backoff = drainInitialBackoff
+		p.spool.Complete(msg.Token)
+	}
+}
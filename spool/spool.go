@@ -0,0 +1,255 @@
+// Package spool implements a durable, FIFO, on-disk outbox for job status
+// updates that couldn't be published to AMQP. It borrows the token
+// indirection pattern used by osbuild-composer's worker server: each queued
+// update is given a UUID token, the update's JSON body is written to
+// pending/$token, and a BoltDB index records the FIFO order of tokens still
+// awaiting publish. Once an update has been published successfully its
+// artifact is renamed from pending/$token to done/$token, where a TTL
+// sweeper eventually removes it.
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cyverse-de/messaging/v9"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var log = logrus.WithField("pkg", "spool")
+
+const (
+	queueBucket = "queue"
+
+	pendingDir = "pending"
+	doneDir    = "done"
+
+	// doneTTL is how long a completed artifact is kept around before the
+	// sweeper removes it.
+	doneTTL = 24 * time.Hour
+)
+
+// QueuedUpdate pairs a spooled messaging.UpdateMessage with the token it was
+// stored under, so callers can acknowledge or requeue it.
+type QueuedUpdate struct {
+	Token  string
+	Update *messaging.UpdateMessage
+}
+
+// Spool is a durable, FIFO outbox for messaging.UpdateMessage values. It is
+// safe for concurrent use.
+type Spool struct {
+	dir string
+	db  *bolt.DB
+
+	ready chan *QueuedUpdate
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New opens (creating if necessary) a spool rooted at dir. Any updates left
+// over from a previous run are loaded and made available via Ready.
+func New(dir string) (*Spool, error) {
+	for _, sub := range []string{pendingDir, doneDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create spool directory %s: %w", sub, err)
+		}
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, "index.db"), 0o644, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the spool index: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(queueBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize the spool index: %w", err)
+	}
+
+	s := &Spool{
+		dir:   dir,
+		db:    db,
+		ready: make(chan *QueuedUpdate, 64),
+		done:  make(chan struct{}),
+	}
+
+	// loadPending feeds potentially more entries than ready's buffer holds,
+	// and callers don't start draining ready until after New returns, so
+	// this can't run synchronously here without risking a deadlock on a
+	// backlog bigger than the buffer. Run it in the background instead.
+	s.wg.Add(1)
+	go s.loadPending()
+
+	s.wg.Add(1)
+	go s.sweep()
+
+	return s, nil
+}
+
+// loadPending walks the queue index in order and feeds anything still
+// pending into the ready channel, so updates left over from a previous
+// process restart aren't lost.
+func (s *Spool) loadPending() {
+	defer s.wg.Done()
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(queueBucket)).Cursor()
+		for _, token := c.First(); token != nil; _, token = c.Next() {
+			msg, err := s.readArtifact(string(token))
+			if err != nil {
+				log.Errorf("spool: skipping unreadable artifact %s: %s", token, err)
+				continue
+			}
+			s.ready <- &QueuedUpdate{Token: string(token), Update: msg}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("spool: failed to load pending updates: %s", err)
+	}
+}
+
+// Enqueue durably records msg and returns the token it was stored under.
+// The update becomes available on Ready once it has been safely written to
+// disk.
+func (s *Spool) Enqueue(msg *messaging.UpdateMessage) (string, error) {
+	token := uuid.NewString()
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal update for spooling: %w", err)
+	}
+
+	if err := os.WriteFile(s.artifactPath(pendingDir, token), body, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write spooled artifact: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queueBucket))
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(seq), []byte(token))
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to index spooled artifact: %w", err)
+	}
+
+	s.ready <- &QueuedUpdate{Token: token, Update: msg}
+
+	return token, nil
+}
+
+// Ready returns the channel of updates awaiting publish, in FIFO order.
+func (s *Spool) Ready() <-chan *QueuedUpdate {
+	return s.ready
+}
+
+// Requeue puts an update that failed to (re-)publish back at the end of the
+// queue so the drainer will retry it later.
+func (s *Spool) Requeue(u *QueuedUpdate) {
+	s.ready <- u
+}
+
+// Complete marks token's artifact as published by moving it from pending/
+// to done/ and removing it from the FIFO index. It is a no-op if token is
+// unknown.
+func (s *Spool) Complete(token string) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queueBucket))
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if string(v) == token {
+				return b.Delete(k)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("spool: failed to remove %s from the index: %s", token, err)
+	}
+
+	if err := os.Rename(s.artifactPath(pendingDir, token), s.artifactPath(doneDir, token)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("spool: failed to mark %s done: %s", token, err)
+	}
+}
+
+// Close stops the sweeper and closes the index. Any updates still queued on
+// disk will be picked back up the next time New is called against dir.
+func (s *Spool) Close() {
+	close(s.done)
+	s.wg.Wait()
+	_ = s.db.Close()
+}
+
+// itob encodes a sequence number as a big-endian byte slice so that BoltDB's
+// natural key ordering matches FIFO order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func (s *Spool) artifactPath(sub, token string) string {
+	return filepath.Join(s.dir, sub, token)
+}
+
+func (s *Spool) readArtifact(token string) (*messaging.UpdateMessage, error) {
+	body, err := os.ReadFile(s.artifactPath(pendingDir, token))
+	if err != nil {
+		return nil, err
+	}
+	var msg messaging.UpdateMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// sweep periodically removes done/ artifacts older than doneTTL.
+func (s *Spool) sweep() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sweepOnce()
+		}
+	}
+}
+
+func (s *Spool) sweepOnce() {
+	entries, err := os.ReadDir(filepath.Join(s.dir, doneDir))
+	if err != nil {
+		log.Errorf("spool: sweep failed to list done artifacts: %s", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-doneTTL)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, doneDir, e.Name())); err != nil {
+			log.Errorf("spool: failed to remove expired artifact %s: %s", e.Name(), err)
+		}
+	}
+}
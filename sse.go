@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// sseKeepaliveInterval is how often a `: keepalive` comment is written to
+// an idle SSE stream to keep intermediate proxies from closing it.
+const sseKeepaliveInterval = 15 * time.Second
+
+// sseEvents streams job status updates as they're published, in the
+// `text/event-stream` format. If the request was routed with a `uuid` path
+// variable, only updates for that job are written; otherwise every update
+// is streamed.
+func sseEvents(publisher JobUpdatePublisher, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	jobID := mux.Vars(r)["uuid"]
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	updates := publisher.Subscribe()
+	defer publisher.Unsubscribe(updates)
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if jobID != "" && update.Job.InvocationID != jobID {
+				continue
+			}
+			body, err := json.Marshal(update)
+			if err != nil {
+				log.Errorf("sse: failed to marshal update: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", body)
+			flusher.Flush()
+
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}